@@ -0,0 +1,75 @@
+package logrusx
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/zfs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	zfsOpTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cerana",
+			Subsystem: "zfs",
+			Name:      "ioctl_total",
+			Help:      "Number of zfs ioctl operations issued, by op and result.",
+		},
+		[]string{"op", "result"},
+	)
+	zfsOpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cerana",
+			Subsystem: "zfs",
+			Name:      "ioctl_duration_seconds",
+			Help:      "Duration of zfs ioctl operations, by op.",
+		},
+		[]string{"op"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(zfsOpTotal, zfsOpDuration)
+}
+
+// ZFSLogger adapts zfs.Logger to logrus, recording a Prometheus counter and
+// histogram for every operation alongside the log entry.
+type ZFSLogger struct {
+	Logger *log.Logger
+}
+
+// NewZFSLogger returns a zfs.Logger that writes through logger. If logger is
+// nil, log.StandardLogger() is used.
+func NewZFSLogger(logger *log.Logger) *ZFSLogger {
+	if logger == nil {
+		logger = log.StandardLogger()
+	}
+	return &ZFSLogger{Logger: logger}
+}
+
+// Log implements zfs.Logger.
+func (z *ZFSLogger) Log(op, name string, args map[string]interface{}, err error, duration time.Duration) {
+	result := "success"
+	entry := z.Logger.WithFields(log.Fields{
+		"op":       op,
+		"name":     name,
+		"args":     args,
+		"duration": duration,
+	})
+	if err != nil {
+		result = "error"
+		entry = entry.WithField("error", err)
+	}
+
+	zfsOpTotal.WithLabelValues(op, result).Inc()
+	zfsOpDuration.WithLabelValues(op).Observe(duration.Seconds())
+
+	if err != nil {
+		entry.Error("zfs ioctl failed")
+		return
+	}
+	entry.Debug("zfs ioctl")
+}
+
+var _ zfs.Logger = (*ZFSLogger)(nil)
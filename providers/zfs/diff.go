@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/zfs"
+)
+
+// DiffArgs are arguments for the Diff handler.
+type DiffArgs struct {
+	Name     string `json:"name"`
+	FromSnap string `json:"fromSnap"`
+}
+
+// Diff returns the inode-level changes between a snapshot and the current
+// state of a dataset.
+func (z *ZFS) Diff(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args DiffArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Name == "" {
+		return nil, nil, errors.New("missing arg: name")
+	}
+	if args.FromSnap == "" {
+		return nil, nil, errors.New("missing arg: fromSnap")
+	}
+
+	ds, err := zfs.GetDataset(args.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := ds.Diff(args.FromSnap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return changes, nil, nil
+}
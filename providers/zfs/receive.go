@@ -0,0 +1,66 @@
+package zfs
+
+import (
+	"errors"
+	"net/url"
+	"os"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/zfs"
+)
+
+// ReceiveArgs are arguments for the Receive handler.
+type ReceiveArgs struct {
+	Name       string                 `json:"name"`
+	SourcePath string                 `json:"sourcePath"`
+	Origin     string                 `json:"origin"`
+	Force      bool                   `json:"force"`
+	Resumable  bool                   `json:"resumable"`
+	Props      map[string]interface{} `json:"props"`
+}
+
+// ReceiveResult is the result of the Receive handler.
+type ReceiveResult struct {
+	Read        uint64           `json:"read"`
+	ResumeToken string           `json:"resumeToken"`
+	ErrorList   map[string]int32 `json:"errorList"`
+}
+
+// Receive creates a dataset from a zfs send stream read from SourcePath.
+func (z *ZFS) Receive(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args ReceiveArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Name == "" {
+		return nil, nil, errors.New("missing arg: name")
+	}
+	if args.SourcePath == "" {
+		return nil, nil, errors.New("missing arg: sourcePath")
+	}
+
+	in, err := os.Open(args.SourcePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+
+	opts := &zfs.ReceiveOptions{
+		Origin:    args.Origin,
+		Force:     args.Force,
+		Resumable: args.Resumable,
+		Props:     args.Props,
+	}
+
+	_, result, err := zfs.ReceiveSnapshot(in, args.Name, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ReceiveResult{
+		Read:        result.Read,
+		ResumeToken: result.ResumeToken,
+		ErrorList:   result.ErrorList,
+	}, nil, nil
+}
@@ -0,0 +1,83 @@
+package zfs
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/zfs"
+)
+
+// SendArgs are arguments for the Send handler.
+type SendArgs struct {
+	Name               string `json:"name"`
+	From               string `json:"from"`
+	Replication        bool   `json:"replication"`
+	DeduplicatedStream bool   `json:"deduplicatedStream"`
+	LargeBlock         bool   `json:"largeBlock"`
+	EmbedData          bool   `json:"embedData"`
+	Compressed         bool   `json:"compressed"`
+	Raw                bool   `json:"raw"`
+	ResumeToken        string `json:"resumeToken"`
+	DestPath           string `json:"destPath"`
+}
+
+// Send writes a dataset's send stream to DestPath.
+func (z *ZFS) Send(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args SendArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Name == "" {
+		return nil, nil, errors.New("missing arg: name")
+	}
+	if args.DestPath == "" {
+		return nil, nil, errors.New("missing arg: destPath")
+	}
+
+	ds, err := zfs.GetDataset(args.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := os.Create(args.DestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer out.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copyErrCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(out, r)
+		r.Close()
+		copyErrCh <- err
+	}()
+
+	opts := &zfs.SendOptions{
+		From:               args.From,
+		Replication:        args.Replication,
+		DeduplicatedStream: args.DeduplicatedStream,
+		LargeBlock:         args.LargeBlock,
+		EmbedData:          args.EmbedData,
+		Compressed:         args.Compressed,
+		Raw:                args.Raw,
+		ResumeToken:        args.ResumeToken,
+	}
+
+	sendErr := ds.SendSnapshot(w.Fd(), opts)
+	w.Close()
+	copyErr := <-copyErrCh
+
+	if sendErr != nil {
+		return nil, nil, sendErr
+	}
+	return nil, nil, copyErr
+}
@@ -1,4 +1,4 @@
-package main
+package zfs
 
 import (
 	"errors"
@@ -7,7 +7,7 @@ import (
 	"reflect"
 	"strings"
 
-	"github.com/mistifyio/gozfs/nv"
+	"github.com/cerana/cerana/zfs/nv"
 )
 
 const (
@@ -50,6 +50,7 @@ type dmuObjsetStats struct {
 }
 
 type dsProperties struct {
+	Atime                propBoolWithSource   `nv:"atime"`
 	Available            propUint64           `nv:"available"`
 	Clones               propClones           `nv:"clones"`
 	Compression          propStringWithSource `nv:"compression"`
@@ -64,11 +65,13 @@ type dsProperties struct {
 	ObjsetID             propUint64           `nv:"objsetid"`
 	Origin               propString           `nv:"origin"`
 	Quota                propUint64WithSource `nv:"quota"`
+	Readonly             propBoolWithSource   `nv:"readonly"`
 	RefCompressRatio     propUint64           `nv:"refcompressratio"`
 	RefQuota             propUint64WithSource `nv:"refquota"`
 	RefReservation       propUint64WithSource `nv:"refreservation"`
 	Referenced           propUint64           `nv:"referenced"`
 	Reservation          propUint64WithSource `nv:"reservation"`
+	Sharenfs             propStringWithSource `nv:"sharenfs"`
 	Type                 propUint64           `nv:"type"`
 	Unique               propUint64           `nv:"unique"`
 	Used                 propUint64           `nv:"used"`
@@ -136,6 +139,15 @@ func (p propStringWithSource) value() string {
 	return p.Value
 }
 
+type propBoolWithSource struct {
+	Source string `nv:"source"`
+	Value  bool   `nv:"value"`
+}
+
+func (p propBoolWithSource) value() bool {
+	return p.Value
+}
+
 func dsToDataset(in *ds) *Dataset {
 	var dsType string
 	if in.DMUObjsetStats.IsSnapshot {
@@ -244,10 +256,20 @@ func CreateVolume(name string, size uint64, properties map[string]interface{}) (
 	return createDataset(name, dmuZVOL, properties)
 }
 
-// ReceiveSnapshot creates a snapshot from a zfs send stream
-func ReceiveSnapshot(input io.Reader, name string) (*Dataset, error) {
-	// TODO: Fix when zfs receive is implemented
-	return nil, errors.New("zfs receive not yet implemented")
+// ReceiveSnapshot creates a dataset from a zfs send stream, optionally
+// configured by opts. It returns the resulting dataset along with a
+// ReceiveResult describing what the kernel reported about the transfer.
+func ReceiveSnapshot(input io.Reader, name string, opts *ReceiveOptions) (*Dataset, *ReceiveResult, error) {
+	result, err := receive(input, name, opts)
+	if err != nil {
+		return nil, result, err
+	}
+
+	ds, err := GetDataset(name)
+	if err != nil {
+		return nil, result, err
+	}
+	return ds, result, nil
 }
 
 // Children returns a list of children of the dataset
@@ -312,8 +334,105 @@ func (d *Dataset) Destroy(opts *DestroyOptions) error {
 	return destroy(d.Name, opts.Defer)
 }
 
-func (d *Dataset) Diff(name string) {
-	// TODO: Implement when we have a zfs diff implementation
+// collectDestroyGraph walks d's descendants (if flags has DestroyRecursive)
+// and clones (if flags has DestroyRecursiveClones), appending each node to
+// order only after its own descendants and clones have been appended. This
+// gives a safe destroy order: clones before origins, children before
+// parents.
+func collectDestroyGraph(d *Dataset, flags DestroyFlag, seen map[string]bool, order *[]*Dataset) error {
+	if seen[d.Name] {
+		return nil
+	}
+	seen[d.Name] = true
+
+	if flags&DestroyRecursiveClones != 0 {
+		for cloneName := range d.ds.Properties.Clones.Value {
+			clone, err := GetDataset(cloneName)
+			if err != nil {
+				return err
+			}
+			if err := collectDestroyGraph(clone, flags, seen, order); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flags&DestroyRecursive != 0 {
+		children, err := d.Children(1)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := collectDestroyGraph(child, flags, seen, order); err != nil {
+				return err
+			}
+		}
+	}
+
+	*order = append(*order, d)
+	return nil
+}
+
+// DestroyWithFlags destroys d, and its descendants and clones as directed
+// by flags, returning the names of everything destroyed (or, with
+// DestroyDryRun, everything that would have been). When the full graph
+// consists only of snapshots, they are destroyed atomically in a single
+// zfs_destroy_snaps ioctl per pool; otherwise each dataset is destroyed in
+// turn, in an order where clones are destroyed before their origins and
+// children before their parents.
+func (d *Dataset) DestroyWithFlags(flags DestroyFlag) ([]string, error) {
+	var order []*Dataset
+	if err := collectDestroyGraph(d, flags, map[string]bool{}, &order); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(order))
+	onlySnapshots := true
+	for i, ds := range order {
+		names[i] = ds.Name
+		if ds.Type != DatasetSnapshot {
+			onlySnapshots = false
+		}
+	}
+
+	if flags&DestroyDryRun != 0 {
+		return names, nil
+	}
+
+	// TODO: Implement unmounting for DestroyForceUmount when we have unmount
+
+	if onlySnapshots && len(order) > 0 {
+		byPool := make(map[string][]string)
+		for _, name := range names {
+			pool := strings.Split(name, "/")[0]
+			byPool[pool] = append(byPool[pool], name)
+		}
+
+		destroyed := make([]string, 0, len(names))
+		for pool, snaps := range byPool {
+			d, err := destroySnapshots(pool, snaps, flags)
+			if err != nil {
+				return destroyed, err
+			}
+			destroyed = append(destroyed, d...)
+		}
+		return destroyed, nil
+	}
+
+	destroyed := make([]string, 0, len(order))
+	for _, ds := range order {
+		if err := destroy(ds.Name, flags&DestroyDeferDeletion != 0); err != nil {
+			return destroyed, err
+		}
+		destroyed = append(destroyed, ds.Name)
+	}
+	return destroyed, nil
+}
+
+// Diff returns the inode-level changes between fromSnap and the current
+// state of the dataset.
+func (d *Dataset) Diff(fromSnap string) ([]*InodeChange, error) {
+	return diff(d.Name, fromSnap)
 }
 
 func (d *Dataset) GetProperty(name string) (interface{}, error) {
@@ -326,9 +445,38 @@ func (d *Dataset) GetProperty(name string) (interface{}, error) {
 	return property.value(), nil
 }
 
+// SetProperty sets a single property on the dataset.
 func (d *Dataset) SetProperty(name string, value interface{}) error {
-	// TODO: Implement when we have a zfs set property implementation
-	return errors.New("zfs set property not implemented yet")
+	return d.SetProperties(map[string]interface{}{name: value})
+}
+
+// SetProperties sets multiple properties on the dataset via a single ioctl,
+// so that either all of them are applied or none are.
+func (d *Dataset) SetProperties(properties map[string]interface{}) error {
+	if err := setProperties(d.Name, properties); err != nil {
+		return err
+	}
+	return d.refresh()
+}
+
+// InheritProperty reverts name back to its inherited value, or its received
+// value if received is true.
+func (d *Dataset) InheritProperty(name string, received bool) error {
+	if err := inheritProperty(d.Name, name, received); err != nil {
+		return err
+	}
+	return d.refresh()
+}
+
+// refresh reloads the dataset's cached properties from zfs. It is called
+// after operations, such as property changes, that can alter them.
+func (d *Dataset) refresh() error {
+	fresh, err := GetDataset(d.Name)
+	if err != nil {
+		return err
+	}
+	*d = *fresh
+	return nil
 }
 
 func (d *Dataset) Rollback(destroyMoreRecent bool) error {
@@ -337,9 +485,17 @@ func (d *Dataset) Rollback(destroyMoreRecent bool) error {
 	return err
 }
 
+// SendSnapshot writes a send stream for the dataset to outputFD. opts may be
+// nil for a full, non-incremental send.
 // TODO: Decide whether asking for a fd here instead of an io.Writer is ok
-func (d *Dataset) SendSnapshot(outputFD uintptr) error {
-	return send(d.Name, outputFD, "", false, false)
+func (d *Dataset) SendSnapshot(outputFD uintptr, opts *SendOptions) error {
+	return send(d.Name, outputFD, opts)
+}
+
+// SendSize estimates, via a dry-run send, the number of bytes that
+// SendSnapshot would write to its output for the same opts.
+func (d *Dataset) SendSize(opts *SendOptions) (uint64, error) {
+	return sendSize(d.Name, opts)
 }
 
 func (d *Dataset) Snapshot(name string, recursive bool) error {
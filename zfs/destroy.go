@@ -7,6 +7,8 @@ import (
 )
 
 func destroy(name string, deferFlag bool) error {
+	done := logOp("destroy", name, map[string]interface{}{"defer": deferFlag})
+
 	m := map[string]interface{}{
 		"cmd":     "zfs_destroy",
 		"version": uint64(0),
@@ -16,8 +18,59 @@ func destroy(name string, deferFlag bool) error {
 	encoded := &bytes.Buffer{}
 	err := nv.NewNativeEncoder(encoded).Encode(m)
 	if err != nil {
-		return err
+		return done(err)
+	}
+
+	return done(ioctl(zfs, name, encoded.Bytes(), nil))
+}
+
+// DestroyFlag is a bitmask of options for Dataset.DestroyWithFlags.
+type DestroyFlag uint32
+
+const (
+	// DestroyDefault destroys just the dataset itself.
+	DestroyDefault DestroyFlag = 0
+	// DestroyRecursive also destroys all descendants of the dataset.
+	DestroyRecursive DestroyFlag = 1 << (iota - 1)
+	// DestroyRecursiveClones also destroys any clones of the dataset or its
+	// descendants.
+	DestroyRecursiveClones
+	// DestroyForceUmount forces any mounted filesystems to be unmounted
+	// before being destroyed.
+	DestroyForceUmount
+	// DestroyDeferDeletion marks snapshots for deferred destruction instead
+	// of failing if they have holds or clones.
+	DestroyDeferDeletion
+	// DestroyDryRun reports what would be destroyed, in the order it would
+	// be destroyed in, without destroying anything.
+	DestroyDryRun
+)
+
+// destroySnapshots invokes zfs_destroy_snaps once for every snapshot in
+// names, all of which must belong to pool, atomically destroying them as a
+// single ioctl.
+func destroySnapshots(pool string, names []string, flags DestroyFlag) ([]string, error) {
+	done := logOp("destroy_snaps", pool, map[string]interface{}{"names": names, "flags": flags})
+
+	snaps := make(map[string]bool, len(names))
+	for _, name := range names {
+		snaps[name] = true
 	}
 
-	return ioctl(zfs, name, encoded.Bytes(), nil)
+	m := map[string]interface{}{
+		"cmd":     "zfs_destroy_snaps",
+		"version": uint64(0),
+		"snaps":   snaps,
+		"defer":   flags&DestroyDeferDeletion != 0,
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return nil, done(err)
+	}
+
+	if err := ioctl(zfs, pool, encoded.Bytes(), nil); err != nil {
+		return nil, done(err)
+	}
+	return names, done(nil)
 }
@@ -0,0 +1,240 @@
+package zfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cerana/cerana/zfs/nv"
+)
+
+// InodeType is the type of filesystem object referenced by an InodeChange.
+type InodeType int
+
+// Inode types, as reported by the zfs_obj_to_path ioctl used to resolve a
+// diffed object number into a path.
+const (
+	BlockDevice InodeType = iota
+	CharacterDevice
+	Directory
+	Door
+	NamedPipe
+	SymbolicLink
+	EventPort
+	Socket
+	File
+)
+
+// ChangeType is the kind of change an InodeChange represents.
+type ChangeType int
+
+// Change types an InodeChange can describe.
+const (
+	Removed ChangeType = iota
+	Created
+	Modified
+	Renamed
+)
+
+// InodeChange describes a single inode-level difference between two
+// snapshots, or between a snapshot and the live filesystem.
+type InodeChange struct {
+	Change               ChangeType
+	Path                 string
+	NewPath              string
+	ReferenceCountChange int
+	Type                 InodeType
+}
+
+var diffInodeTypes = map[byte]InodeType{
+	'B': BlockDevice,
+	'C': CharacterDevice,
+	'D': Directory,
+	'O': Door,
+	'P': NamedPipe,
+	'L': SymbolicLink,
+	'E': EventPort,
+	'S': Socket,
+	'F': File,
+}
+
+// diffRangeKind is what a dmuDiffRecord says about the object range it
+// covers.
+type diffRangeKind uint64
+
+const (
+	diffRangeNone  diffRangeKind = 0x1 // no information; the range is unchanged
+	diffRangeInuse diffRangeKind = 0x2 // every object in the range is still in use
+	diffRangeFree  diffRangeKind = 0x4 // every object in the range was freed
+)
+
+// dmuDiffRecord mirrors the kernel's dmu_diff_record_t: ZFS_IOC_DIFF streams
+// these binary records back through the pipe, each covering an inclusive
+// range of object numbers. It carries no path information of its own - that
+// has to be resolved separately, per object, via zfs_obj_to_path, the same
+// step libzfs performs in userspace on behalf of the "zfs diff" command.
+type dmuDiffRecord struct {
+	Kind  diffRangeKind
+	First uint64
+	Last  uint64
+}
+
+const dmuDiffRecordSize = 24 // three uint64 fields, as the kernel lays them out
+
+func readDiffRecord(r io.Reader) (*dmuDiffRecord, error) {
+	var raw [dmuDiffRecordSize]byte
+	if _, err := io.ReadFull(r, raw[:]); err != nil {
+		return nil, err
+	}
+	return &dmuDiffRecord{
+		Kind:  diffRangeKind(binary.LittleEndian.Uint64(raw[0:8])),
+		First: binary.LittleEndian.Uint64(raw[8:16]),
+		Last:  binary.LittleEndian.Uint64(raw[16:24]),
+	}, nil
+}
+
+// diff invokes ZFS_IOC_DIFF for name against fromSnap and resolves the
+// binary dmuDiffRecord stream the kernel writes back through a pipe into a
+// list of InodeChanges.
+func diff(name, fromSnap string) ([]*InodeChange, error) {
+	done := logOp("diff", name, map[string]interface{}{"fromsnap": fromSnap})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, done(err)
+	}
+	defer r.Close()
+
+	m := map[string]interface{}{
+		"cmd":      "zfs_diff",
+		"version":  uint64(0),
+		"fd":       uint64(w.Fd()),
+		"fromsnap": fromSnap,
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		w.Close()
+		return nil, done(err)
+	}
+
+	var ioctlErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ioctlErr = ioctl(zfs, name, encoded.Bytes(), nil)
+		w.Close()
+	}()
+
+	changes, resolveErr := resolveDiffStream(name, fromSnap, r)
+	wg.Wait()
+
+	if ioctlErr != nil {
+		return nil, done(ioctlErr)
+	}
+	if resolveErr != nil {
+		return nil, done(resolveErr)
+	}
+	return changes, done(nil)
+}
+
+// resolveDiffStream reads dmuDiffRecords off r and resolves every in-use or
+// freed object number into an InodeChange.
+func resolveDiffStream(name, fromSnap string, r io.Reader) ([]*InodeChange, error) {
+	fromName := fmt.Sprintf("%s@%s", poolName(name), fromSnap)
+
+	var changes []*InodeChange
+	for {
+		rec, err := readDiffRecord(r)
+		if err == io.EOF {
+			return changes, nil
+		}
+		if err != nil {
+			return changes, err
+		}
+		if rec.Kind == diffRangeNone {
+			continue
+		}
+
+		for obj := rec.First; obj <= rec.Last; obj++ {
+			change, err := resolveDiffObject(name, fromName, obj, rec.Kind == diffRangeFree)
+			if err != nil {
+				return changes, err
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+		}
+	}
+}
+
+// resolveDiffObject compares obj's path on fromName against its path on
+// name to decide whether it was created, removed, renamed or modified.
+func resolveDiffObject(name, fromName string, obj uint64, freed bool) (*InodeChange, error) {
+	toPath, toType, toLinks, toErr := objToPath(name, obj)
+	if freed {
+		toErr = errNoSuchObject
+	}
+	fromPath, _, fromLinks, fromErr := objToPath(fromName, obj)
+
+	switch {
+	case fromErr != nil && toErr != nil:
+		return nil, nil
+	case fromErr != nil:
+		return &InodeChange{Change: Created, Path: toPath, Type: toType, ReferenceCountChange: toLinks}, nil
+	case toErr != nil:
+		return &InodeChange{Change: Removed, Path: fromPath, ReferenceCountChange: -fromLinks}, nil
+	case fromPath != toPath:
+		return &InodeChange{Change: Renamed, Path: fromPath, NewPath: toPath, Type: toType, ReferenceCountChange: toLinks - fromLinks}, nil
+	default:
+		return &InodeChange{Change: Modified, Path: toPath, Type: toType, ReferenceCountChange: toLinks - fromLinks}, nil
+	}
+}
+
+var errNoSuchObject = fmt.Errorf("object does not exist")
+
+// poolName returns the pool component of a dataset name, e.g. "tank" for
+// "tank/foo/bar".
+func poolName(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// objToPath invokes the zfs_obj_to_path ioctl, resolving obj within name to
+// its path, inode type and current link count.
+func objToPath(name string, obj uint64) (path string, typ InodeType, links int, err error) {
+	m := map[string]interface{}{
+		"cmd":     "zfs_obj_to_path",
+		"version": uint64(0),
+		"obj":     obj,
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return "", 0, 0, err
+	}
+
+	resp := &bytes.Buffer{}
+	if err := ioctl(zfs, name, encoded.Bytes(), resp); err != nil {
+		return "", 0, 0, err
+	}
+
+	var result struct {
+		Path  string `nv:"path"`
+		Type  string `nv:"type"`
+		Links int    `nv:"links"`
+	}
+	if err := nv.NewNativeDecoder(resp).Decode(&result); err != nil {
+		return "", 0, 0, err
+	}
+
+	inodeType, ok := diffInodeTypes[result.Type[0]]
+	if !ok {
+		return "", 0, 0, fmt.Errorf("unknown inode type %q for object %d on %s", result.Type, obj, name)
+	}
+	return result.Path, inodeType, result.Links, nil
+}
@@ -0,0 +1,324 @@
+// Package graphdriver implements a Docker graphdriver backed directly by
+// the cerana zfs package's ioctl-based Dataset API, so container image
+// layers live on ZFS datasets without shelling out to the zfs(8) binary.
+package graphdriver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cerana/cerana/zfs"
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/mount"
+)
+
+const driverName = "cerana-zfs"
+
+func init() {
+	graphdriver.Register(driverName, Init)
+}
+
+// Driver is a Docker graphdriver backed by a zfs dataset tree.
+type Driver struct {
+	dataset   string
+	mountRoot string
+	mountOpt  string
+}
+
+// Init constructs a Driver rooted at the zfs filesystem named by the
+// "zfs.fsname" option (defaulting to the pool mounted at root), verifying
+// that root is in fact backed by zfs.
+func Init(root string, options []string, uidMaps, gidMaps []idtools.IDMap) (graphdriver.Driver, error) {
+	if err := checkRootdirFs(root); err != nil {
+		return nil, err
+	}
+
+	fsname, mountOpt, err := parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if fsname == "" {
+		ds, err := datasetForPath(root)
+		if err != nil {
+			return nil, err
+		}
+		fsname = ds
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	d := &Driver{
+		dataset:   fsname,
+		mountRoot: root,
+		mountOpt:  mountOpt,
+	}
+
+	return d, nil
+}
+
+func parseOptions(options []string) (fsname, mountOpt string, err error) {
+	for _, opt := range options {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return "", "", fmt.Errorf("invalid graphdriver option: %s", opt)
+		}
+		switch kv[0] {
+		case "zfs.fsname":
+			fsname = kv[1]
+		case "zfs.mountopt":
+			mountOpt = kv[1]
+		default:
+			return "", "", fmt.Errorf("unknown zfs graphdriver option: %s", kv[0])
+		}
+	}
+	return fsname, mountOpt, nil
+}
+
+// checkRootdirFs verifies that root is on a zfs mount, by consulting
+// /proc/mounts rather than relying on the caller's configuration alone. It
+// picks the longest zfs mountpoint that is a path-boundary-respecting
+// ancestor of root, the same precedence the kernel itself applies when
+// resolving overlapping mounts.
+func checkRootdirFs(root string) error {
+	mounts, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	var best string
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mountPoint, fsType := fields[1], fields[2]
+		if fsType != "zfs" || !isPathAncestor(mountPoint, absRoot) {
+			continue
+		}
+		if len(mountPoint) > len(best) {
+			best = mountPoint
+		}
+	}
+	if best == "" {
+		return fmt.Errorf("%s is not backed by zfs", root)
+	}
+	return nil
+}
+
+// isPathAncestor reports whether ancestor is path equal to, or a
+// path-component-boundary-respecting ancestor of, path.
+func isPathAncestor(ancestor, path string) bool {
+	ancestor = filepath.Clean(ancestor)
+	path = filepath.Clean(path)
+	if ancestor == path {
+		return true
+	}
+	if ancestor == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, ancestor+string(filepath.Separator))
+}
+
+func datasetForPath(path string) (string, error) {
+	datasets, err := zfs.Filesystems("")
+	if err != nil {
+		return "", err
+	}
+	for _, ds := range datasets {
+		if ds.Mountpoint == path {
+			return ds.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no zfs filesystem mounted at %s", path)
+}
+
+func (d *Driver) datasetName(id string) string {
+	return fmt.Sprintf("%s/%s", d.dataset, id)
+}
+
+func (d *Driver) mountPath(id string) string {
+	return filepath.Join(d.mountRoot, "mnt", id)
+}
+
+// String returns the driver's registered name.
+func (d *Driver) String() string {
+	return driverName
+}
+
+// Create snapshots parent (if any) and clones it to form the new layer id.
+func (d *Driver) Create(id, parent, mountLabel string, storageOpt map[string]string) error {
+	name := d.datasetName(id)
+
+	if parent == "" {
+		return zfs.CreateFilesystem(name, map[string]interface{}{"mountpoint": "legacy"})
+	}
+	parentName := d.datasetName(parent)
+
+	ds, err := zfs.GetDataset(parentName)
+	if err != nil {
+		return err
+	}
+
+	snapName := fmt.Sprintf("create-%s", id)
+	if err := ds.Snapshot(snapName, false); err != nil {
+		return err
+	}
+
+	snap, err := zfs.GetDataset(fmt.Sprintf("%s@%s", parentName, snapName))
+	if err != nil {
+		return err
+	}
+
+	if _, err := snap.Clone(name, map[string]interface{}{"mountpoint": "legacy"}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Remove destroys id's dataset along with any clones descended from it,
+// deferring destruction of anything still held or cloned rather than
+// failing outright.
+func (d *Driver) Remove(id string) error {
+	ds, err := zfs.GetDataset(d.datasetName(id))
+	if err != nil {
+		return err
+	}
+	_, err = ds.DestroyWithFlags(zfs.DestroyRecursive | zfs.DestroyRecursiveClones | zfs.DestroyForceUmount | zfs.DestroyDeferDeletion)
+	return err
+}
+
+// Get ensures id's dataset is mounted at its mount path and returns that
+// path. The dataset's mountpoint property is set to "legacy" so zfs itself
+// never auto-mounts it elsewhere; the actual mount onto mountPath is done
+// directly, since ds.Mount would mount at the (now legacy) mountpoint
+// property rather than at the driver's layout.
+func (d *Driver) Get(id, mountLabel string) (string, error) {
+	ds, err := zfs.GetDataset(d.datasetName(id))
+	if err != nil {
+		return "", err
+	}
+
+	if err := ds.SetProperty("mountpoint", "legacy"); err != nil {
+		return "", err
+	}
+
+	mountPath := d.mountPath(id)
+	if err := os.MkdirAll(mountPath, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	if err := mount.Mount(ds.Name, mountPath, "zfs", d.mountOpt); err != nil {
+		return "", err
+	}
+	return mountPath, nil
+}
+
+// Put unmounts id's dataset from its mount path.
+func (d *Driver) Put(id string) error {
+	return mount.Unmount(d.mountPath(id))
+}
+
+// Exists reports whether id has a backing dataset.
+func (d *Driver) Exists(id string) bool {
+	_, err := zfs.GetDataset(d.datasetName(id))
+	return err == nil
+}
+
+// Diff returns an archive of the changes between id and its parent,
+// computed from the dataset's ZFS diff rather than a generic tree walk.
+func (d *Driver) Diff(id, parent string) (archive.Archive, error) {
+	changes, err := d.Changes(id, parent)
+	if err != nil {
+		return nil, err
+	}
+	return archive.ExportChanges(d.mountPath(id), changes)
+}
+
+// Changes reports the files added, modified or deleted between id and
+// parent, via Dataset.Diff.
+func (d *Driver) Changes(id, parent string) ([]archive.Change, error) {
+	ds, err := zfs.GetDataset(d.datasetName(id))
+	if err != nil {
+		return nil, err
+	}
+
+	// The create-<id> snapshot lives on parent, not on id itself; id's
+	// clone only carries it as its origin.
+	inodeChanges, err := ds.Diff(ds.Origin)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]archive.Change, 0, len(inodeChanges))
+	for _, c := range inodeChanges {
+		var kind archive.ChangeType
+		switch c.Change {
+		case zfs.Created:
+			kind = archive.ChangeAdd
+		case zfs.Removed:
+			kind = archive.ChangeDelete
+		default:
+			kind = archive.ChangeModify
+		}
+		changes = append(changes, archive.Change{Path: c.Path, Kind: kind})
+	}
+	return changes, nil
+}
+
+// ApplyDiff extracts the tar layer diff onto id's mounted dataset. diff is
+// the same archive.Reader produced by Diff, not a zfs send stream, so it is
+// untarred directly (via archive.ApplyLayer) rather than passed to
+// ReceiveSnapshot.
+func (d *Driver) ApplyDiff(id, parent string, diff archive.Reader) (int64, error) {
+	return archive.ApplyLayer(d.mountPath(id), diff)
+}
+
+// DiffSize estimates, via Dataset.SendSize, the size of id's diff from
+// parent.
+func (d *Driver) DiffSize(id, parent string) (int64, error) {
+	ds, err := zfs.GetDataset(d.datasetName(id))
+	if err != nil {
+		return 0, err
+	}
+
+	// As in Changes, the base snapshot is id's origin, not a same-named
+	// snapshot on id itself.
+	size, err := ds.SendSize(&zfs.SendOptions{From: ds.Origin})
+	if err != nil {
+		return 0, err
+	}
+	return int64(size), nil
+}
+
+// Status reports the driver name and dataset root for `docker info`.
+func (d *Driver) Status() [][2]string {
+	return [][2]string{
+		{"Zfs Dataset Root", d.dataset},
+	}
+}
+
+// GetMetadata returns extra debugging metadata about id's dataset.
+func (d *Driver) GetMetadata(id string) (map[string]string, error) {
+	return map[string]string{
+		"Dataset":    d.datasetName(id),
+		"Mountpoint": d.mountPath(id),
+	}, nil
+}
+
+// Cleanup tears down the driver; there is no persistent state to release.
+func (d *Driver) Cleanup() error {
+	return nil
+}
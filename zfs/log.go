@@ -0,0 +1,36 @@
+package zfs
+
+import "time"
+
+// Logger receives a notification for every ioctl-backed zfs operation this
+// package issues, letting operators trace or record metrics for every
+// command sent to the kernel.
+type Logger interface {
+	Log(op, name string, args map[string]interface{}, err error, duration time.Duration)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Log(string, string, map[string]interface{}, error, time.Duration) {}
+
+var logger Logger = noopLogger{}
+
+// SetLogger installs l as the package-wide Logger used to trace ioctl
+// calls. Passing nil restores the default no-op logger.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = noopLogger{}
+	}
+	logger = l
+}
+
+// logOp starts timing a zfs operation and returns a function that should be
+// called with its result, which reports the operation to the installed
+// Logger and returns err unchanged for convenient wrapping at call sites.
+func logOp(op, name string, args map[string]interface{}) func(err error) error {
+	start := time.Now()
+	return func(err error) error {
+		logger.Log(op, name, args, err, time.Since(start))
+		return err
+	}
+}
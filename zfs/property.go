@@ -0,0 +1,116 @@
+package zfs
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cerana/cerana/zfs/nv"
+)
+
+var (
+	propUint64Type    = reflect.TypeOf(propUint64{})
+	propUint64SrcType = reflect.TypeOf(propUint64WithSource{})
+	propStringType    = reflect.TypeOf(propString{})
+	propStringSrcType = reflect.TypeOf(propStringWithSource{})
+	propBoolSrcType   = reflect.TypeOf(propBoolWithSource{})
+)
+
+// coercePropertyValue looks name up in dsPropertyIndexes, validating that it
+// is a known dataset property, and converts value to the type the
+// zfs_set_prop ioctl expects for it, as determined by reflecting on the
+// corresponding dsProperties field.
+func coercePropertyValue(name string, value interface{}) (string, interface{}, error) {
+	index, ok := dsPropertyIndexes[strings.ToLower(name)]
+	if !ok {
+		return "", nil, fmt.Errorf("not a valid property name: %s", name)
+	}
+
+	field := reflect.TypeOf(dsProperties{}).Field(index)
+	propName := strings.SplitN(field.Tag.Get("nv"), ",", 2)[0]
+
+	switch field.Type {
+	case propUint64Type, propUint64SrcType:
+		v, err := toUint64(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("property %s expects a uint64: %v", name, err)
+		}
+		return propName, v, nil
+	case propStringType, propStringSrcType:
+		v, ok := value.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("property %s expects a string", name)
+		}
+		return propName, v, nil
+	case propBoolSrcType:
+		v, ok := value.(bool)
+		if !ok {
+			return "", nil, fmt.Errorf("property %s expects a bool", name)
+		}
+		return propName, v, nil
+	default:
+		return "", nil, fmt.Errorf("property %s is not settable", name)
+	}
+}
+
+func toUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case int:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	default:
+		return 0, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// setProperties submits every property in properties to the zfs_set_prop
+// ioctl in a single nvlist, so that they are applied atomically.
+func setProperties(name string, properties map[string]interface{}) error {
+	done := logOp("set_prop", name, properties)
+
+	props := make(map[string]interface{}, len(properties))
+	for propName, value := range properties {
+		coercedName, coercedValue, err := coercePropertyValue(propName, value)
+		if err != nil {
+			return done(err)
+		}
+		props[coercedName] = coercedValue
+	}
+
+	m := map[string]interface{}{
+		"cmd":        "zfs_set_prop",
+		"version":    uint64(0),
+		"properties": props,
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return done(err)
+	}
+
+	return done(ioctl(zfs, name, encoded.Bytes(), nil))
+}
+
+// inheritProperty invokes the zfs_inherit_prop ioctl, reverting prop back to
+// its inherited value, or its received value if received is true.
+func inheritProperty(name, prop string, received bool) error {
+	done := logOp("inherit_prop", name, map[string]interface{}{"property": prop, "received": received})
+
+	m := map[string]interface{}{
+		"cmd":      "zfs_inherit_prop",
+		"version":  uint64(0),
+		"property": prop,
+		"received": received,
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return done(err)
+	}
+
+	return done(ioctl(zfs, name, encoded.Bytes(), nil))
+}
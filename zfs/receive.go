@@ -0,0 +1,87 @@
+package zfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/cerana/cerana/zfs/nv"
+)
+
+// ReceiveOptions configure a ReceiveSnapshot call.
+type ReceiveOptions struct {
+	Origin    string
+	Force     bool
+	Resumable bool
+	Props     map[string]interface{}
+}
+
+// ReceiveResult reports what the kernel did with a ReceiveSnapshot stream.
+type ReceiveResult struct {
+	Read        uint64           `nv:"read_bytes"`
+	ResumeToken string           `nv:"resume_token"`
+	ErrorList   map[string]int32 `nv:"errors"`
+}
+
+// receive invokes ZFS_IOC_RECV, streaming input into the kernel through a
+// pipe and decoding the resulting status nvlist.
+func receive(input io.Reader, name string, opts *ReceiveOptions) (*ReceiveResult, error) {
+	done := logOp("receive", name, map[string]interface{}{"opts": opts})
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, done(err)
+	}
+	defer r.Close()
+
+	copyErrCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, input)
+		w.Close()
+		copyErrCh <- err
+	}()
+
+	m := map[string]interface{}{
+		"cmd":     "zfs_recv",
+		"version": uint64(0),
+		"fd":      uint64(r.Fd()),
+	}
+	if opts != nil {
+		if opts.Origin != "" {
+			m["origin"] = opts.Origin
+		}
+		if opts.Force {
+			m["force"] = opts.Force
+		}
+		if opts.Resumable {
+			m["resumable"] = opts.Resumable
+		}
+		if len(opts.Props) > 0 {
+			m["props"] = opts.Props
+		}
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return nil, done(err)
+	}
+
+	resp := &bytes.Buffer{}
+	ioctlErr := ioctl(zfs, name, encoded.Bytes(), resp)
+	copyErr := <-copyErrCh
+
+	if ioctlErr != nil {
+		return nil, done(ioctlErr)
+	}
+	if copyErr != nil {
+		return nil, done(copyErr)
+	}
+
+	var result ReceiveResult
+	if resp.Len() > 0 {
+		if err := nv.NewNativeDecoder(resp).Decode(&result); err != nil {
+			return nil, done(err)
+		}
+	}
+	return &result, done(nil)
+}
@@ -0,0 +1,167 @@
+package zfs
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/cerana/cerana/zfs/nv"
+)
+
+// SendOptions configure a Dataset.SendSnapshot or Dataset.SendSize call. A
+// nil *SendOptions means a full, non-incremental send with no flags set.
+type SendOptions struct {
+	From               string
+	Replication        bool
+	DeduplicatedStream bool
+	LargeBlock         bool
+	EmbedData          bool
+	Compressed         bool
+	Raw                bool
+	ResumeToken        string
+	Progress           func(bytes uint64)
+}
+
+// hasFeatureFlags reports whether opts requests any of the zfs_send_new
+// stream features, each of which the ioctl takes as its own boolean nvlist
+// key rather than a combined bitmask.
+func (o *SendOptions) hasFeatureFlags() bool {
+	if o == nil {
+		return false
+	}
+	return o.Replication || o.DeduplicatedStream || o.LargeBlock || o.EmbedData || o.Compressed || o.Raw
+}
+
+// sendCmd picks the ioctl that supports opts: resuming a send, or any of
+// the newer stream feature flags (large blocks, embedded data, compressed,
+// raw, dedup), requires zfs_send_new, since the legacy zfs_send silently
+// ignores flags it doesn't understand.
+func sendCmd(opts *SendOptions) string {
+	if opts != nil && (opts.hasFeatureFlags() || opts.ResumeToken != "") {
+		return "zfs_send_new"
+	}
+	return "zfs_send"
+}
+
+func sendArgs(name string, opts *SendOptions) map[string]interface{} {
+	m := map[string]interface{}{
+		"cmd":     sendCmd(opts),
+		"version": uint64(0),
+	}
+	if opts == nil {
+		return m
+	}
+	if opts.From != "" {
+		m["fromsnap"] = opts.From
+	}
+	if opts.ResumeToken != "" {
+		m["resume_token"] = opts.ResumeToken
+	}
+	if opts.Replication {
+		m["replicate"] = true
+	}
+	if opts.DeduplicatedStream {
+		m["dedup"] = true
+	}
+	if opts.LargeBlock {
+		m["largeblockok"] = true
+	}
+	if opts.EmbedData {
+		m["embedok"] = true
+	}
+	if opts.Compressed {
+		m["compressok"] = true
+	}
+	if opts.Raw {
+		m["rawok"] = true
+	}
+	return m
+}
+
+// send invokes the zfs_send/zfs_send_new ioctl, writing the stream to
+// outputFD, and reports progress to opts.Progress, if set, until the send
+// completes.
+func send(name string, outputFD uintptr, opts *SendOptions) error {
+	logDone := logOp("send", name, sendArgs(name, opts))
+
+	m := sendArgs(name, opts)
+	m["fd"] = uint64(outputFD)
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return logDone(err)
+	}
+
+	if opts == nil || opts.Progress == nil {
+		return logDone(ioctl(zfs, name, encoded.Bytes(), nil))
+	}
+
+	ioctlDone := make(chan error, 1)
+	go func() {
+		ioctlDone <- ioctl(zfs, name, encoded.Bytes(), nil)
+	}()
+
+	for {
+		select {
+		case err := <-ioctlDone:
+			return logDone(err)
+		case <-time.After(time.Second):
+			if sent, err := sendProgress(name); err == nil {
+				opts.Progress(sent)
+			}
+		}
+	}
+}
+
+// sendSize performs a dry-run send to estimate the size, in bytes, of the
+// stream that send would produce for the same name and opts.
+func sendSize(name string, opts *SendOptions) (uint64, error) {
+	done := logOp("send_size", name, sendArgs(name, opts))
+
+	m := sendArgs(name, opts)
+	m["dryrun"] = true
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return 0, done(err)
+	}
+
+	resp := &bytes.Buffer{}
+	if err := ioctl(zfs, name, encoded.Bytes(), resp); err != nil {
+		return 0, done(err)
+	}
+
+	var result struct {
+		Space uint64 `nv:"space"`
+	}
+	if err := nv.NewNativeDecoder(resp).Decode(&result); err != nil {
+		return 0, done(err)
+	}
+	return result.Space, done(nil)
+}
+
+// sendProgress invokes the zfs_send_progress ioctl, returning the number of
+// bytes written by an in-progress send so far.
+func sendProgress(name string) (uint64, error) {
+	m := map[string]interface{}{
+		"cmd":     "zfs_send_progress",
+		"version": uint64(0),
+	}
+
+	encoded := &bytes.Buffer{}
+	if err := nv.NewNativeEncoder(encoded).Encode(m); err != nil {
+		return 0, err
+	}
+
+	resp := &bytes.Buffer{}
+	if err := ioctl(zfs, name, encoded.Bytes(), resp); err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Offset uint64 `nv:"offset"`
+	}
+	if err := nv.NewNativeDecoder(resp).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.Offset, nil
+}